@@ -0,0 +1,49 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+const (
+	// fsTypeKey is the in-tree storage class parameter key for the file
+	// system type
+	fsTypeKey = "fstype"
+	// csiFsTypeKey is the CSI storage class parameter key for the file
+	// system type
+	csiFsTypeKey = "fstype"
+
+	// zoneLabel is the well-known label used to place a PV in a specific
+	// failure-domain zone
+	zoneLabel = "failure-domain.beta.kubernetes.io/zone"
+	// regionLabel is the well-known label used to place a PV in a specific
+	// failure-domain region
+	regionLabel = "failure-domain.beta.kubernetes.io/region"
+
+	// zoneLabelDelimiter is used to join multiple zones in a single
+	// failure-domain label value, e.g. "zone1__zone2__zone3"
+	zoneLabelDelimiter = "__"
+)
+
+// UnsupportedParameterError is returned when an in-tree StorageClass
+// parameter has no safe CSI equivalent and cannot be translated
+// automatically, so the caller needs to resolve it before migrating.
+type UnsupportedParameterError struct {
+	Parameter string
+	Reason    string
+}
+
+func (e *UnsupportedParameterError) Error() string {
+	return "unsupported in-tree storage class parameter " + e.Parameter + ": " + e.Reason
+}
@@ -30,8 +30,47 @@ const (
 	VSphereDriverName = "csi.vsphere.vmware.com"
 	// VSphereInTreePluginName is the name of the intree plugin for vSphere Volume
 	VSphereInTreePluginName = "kubernetes.io/vsphere-volume"
+
+	// topologyZoneKey is the vSphere CSI topology key carrying the
+	// equivalent of the in-tree zone label
+	topologyZoneKey = "topology.csi.vsphere.vmware.com/zone"
+	// topologyRegionKey is the vSphere CSI topology key carrying the
+	// equivalent of the in-tree region label
+	topologyRegionKey = "topology.csi.vsphere.vmware.com/region"
+
+	// diskFormatKey is the in-tree storage class parameter selecting how a
+	// disk is provisioned (thin, zeroedthick, eagerzeroedthick). CSI always
+	// thin-provisions, so this parameter is dropped during translation.
+	diskFormatKey = "diskformat"
+
+	// datastoreKey is the in-tree storage class parameter naming the
+	// datastore to provision on.
+	datastoreKey = "datastore"
+	// csiDatastoreURLKey is the CSI storage class parameter carrying the
+	// same placement intent as datastoreKey. Unlike the in-tree parameter,
+	// the CSI driver requires this to be a datastore URL, not a datastore
+	// name.
+	csiDatastoreURLKey = "datastoreurl"
+
+	// storagePolicyNameKey is the storage class parameter, common to both
+	// in-tree and CSI, naming an existing SPBM storage policy to apply.
+	storagePolicyNameKey = "storagepolicyname"
 )
 
+// spbmPolicyParamKeys are the legacy in-tree storage class parameters used
+// to build an ad hoc SPBM policy out of discrete toggles. The CSI driver
+// only understands a single named SPBM policy, so these cannot be
+// translated directly; see the handling in
+// TranslateInTreeStorageClassToCSI.
+var spbmPolicyParamKeys = map[string]bool{
+	"hostfailurestotolerate": true,
+	"forceprovisioning":      true,
+	"cachereservation":       true,
+	"diskstripes":            true,
+	"objectspacereservation": true,
+	"iopslimit":              true,
+}
+
 var _ InTreePlugin = &vSphereCSITranslator{}
 
 // vSphereCSITranslator handles translation of PV spec from In-tree vSphere Volume to vSphere CSI
@@ -45,24 +84,131 @@ func NewvSphereCSITranslator() InTreePlugin {
 // TranslateInTreeStorageClassToCSI translates InTree vSphere storage class parameters to CSI storage class
 func (t *vSphereCSITranslator) TranslateInTreeStorageClassToCSI(sc *storage.StorageClass) (*storage.StorageClass, error) {
 	var params = map[string]string{}
+	var spbmParams []string
 	for k, v := range sc.Parameters {
-		switch strings.ToLower(k) {
+		switch lk := strings.ToLower(k); lk {
 		case fsTypeKey:
 			params[csiFsTypeKey] = v
+		case diskFormatKey:
+			// CSI always thin-provisions volumes.
+		case datastoreKey:
+			params[csiDatastoreURLKey] = v
+		case storagePolicyNameKey:
+			// Normalize the key so the "already set" check below (and any
+			// other case-sensitive casing in the input) reliably finds it.
+			params[storagePolicyNameKey] = v
 		default:
+			if spbmPolicyParamKeys[lk] {
+				spbmParams = append(spbmParams, k)
+				continue
+			}
 			params[k] = v
 		}
 	}
+
+	if len(spbmParams) > 0 {
+		if _, ok := params[storagePolicyNameKey]; ok {
+			// storagepolicyname already identifies the SPBM policy to
+			// apply; preserve the legacy knobs as annotations instead of
+			// silently dropping them.
+			if sc.Annotations == nil {
+				sc.Annotations = map[string]string{}
+			}
+			for _, k := range spbmParams {
+				sc.Annotations[VSphereDriverName+"/"+strings.ToLower(k)] = sc.Parameters[k]
+			}
+		} else {
+			return nil, &UnsupportedParameterError{
+				Parameter: strings.Join(spbmParams, ", "),
+				Reason:    "the CSI driver requires an existing storagepolicyname; create an SPBM policy covering these requirements and set storagepolicyname instead",
+			}
+		}
+	}
+
 	sc.Parameters = params
+	sc.AllowedTopologies = translateAllowedTopologies(sc.AllowedTopologies)
 	return sc, nil
 }
 
+// translateAllowedTopologies translates the in-tree zone/region topology
+// keys on a StorageClass's AllowedTopologies to their vSphere CSI
+// equivalents, expanding any "__"-delimited multi-zone values into
+// separate entries along the way.
+func translateAllowedTopologies(terms []v1.TopologySelectorTerm) []v1.TopologySelectorTerm {
+	if terms == nil {
+		return nil
+	}
+	newTopologies := make([]v1.TopologySelectorTerm, 0, len(terms))
+	for _, term := range terms {
+		newExprs := make([]v1.TopologySelectorLabelRequirement, 0, len(term.MatchLabelExpressions))
+		for _, expr := range term.MatchLabelExpressions {
+			newExprs = append(newExprs, translateTopologyLabelRequirement(expr))
+		}
+		newTopologies = append(newTopologies, v1.TopologySelectorTerm{MatchLabelExpressions: newExprs})
+	}
+	return newTopologies
+}
+
+// translateTopologyLabelRequirement rewrites a single topology requirement
+// between the in-tree failure-domain keys and the vSphere CSI topology
+// keys, in whichever direction the given key is expressed in.
+func translateTopologyLabelRequirement(expr v1.TopologySelectorLabelRequirement) v1.TopologySelectorLabelRequirement {
+	switch expr.Key {
+	case zoneLabel:
+		return v1.TopologySelectorLabelRequirement{Key: topologyZoneKey, Values: expandZoneValues(expr.Values)}
+	case regionLabel:
+		return v1.TopologySelectorLabelRequirement{Key: topologyRegionKey, Values: expandZoneValues(expr.Values)}
+	case topologyZoneKey:
+		return v1.TopologySelectorLabelRequirement{Key: zoneLabel, Values: joinZoneValues(expr.Values)}
+	case topologyRegionKey:
+		return v1.TopologySelectorLabelRequirement{Key: regionLabel, Values: joinZoneValues(expr.Values)}
+	default:
+		return expr
+	}
+}
+
+// expandZoneValues splits any "__"-delimited multi-zone in-tree label
+// values into separate CSI topology values.
+func expandZoneValues(values []string) []string {
+	var expanded []string
+	for _, v := range values {
+		expanded = append(expanded, strings.Split(v, zoneLabelDelimiter)...)
+	}
+	return expanded
+}
+
+// joinZoneValues re-joins CSI topology values into the "__"-delimited
+// multi-zone convention used by the in-tree zone/region labels.
+func joinZoneValues(values []string) []string {
+	if len(values) == 0 {
+		return values
+	}
+	return []string{strings.Join(values, zoneLabelDelimiter)}
+}
+
 // TranslateInTreeInlineVolumeToCSI takes a Volume with VsphereVolume set from in-tree
 // and converts the VsphereVolume source to a CSIPersistentVolumeSource
-func (t *vSphereCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume) (*v1.PersistentVolume, error) {
+func (t *vSphereCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, readOnly bool) (*v1.PersistentVolume, error) {
 	if volume == nil || volume.VsphereVolume == nil {
 		return nil, fmt.Errorf("volume is nil or VsphereVolume not defined on volume")
 	}
+	accessMode := v1.ReadWriteOnce
+	if readOnly {
+		accessMode = v1.ReadOnlyMany
+	}
+	csiSource := &v1.CSIPersistentVolumeSource{
+		Driver:           VSphereDriverName,
+		VolumeHandle:     volume.VsphereVolume.VolumePath,
+		FSType:           volume.VsphereVolume.FSType,
+		ReadOnly:         readOnly,
+		VolumeAttributes: map[string]string{},
+	}
+	if volume.VsphereVolume.StoragePolicyName != "" {
+		// The CSI driver treats an empty storagepolicyname as an invalid
+		// policy, so omit the attribute entirely rather than pass through
+		// an empty string.
+		csiSource.VolumeAttributes[storagePolicyNameKey] = volume.VsphereVolume.StoragePolicyName
+	}
 	pv := &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			// Must be unique per disk as it is used as the unique part of the
@@ -72,16 +218,9 @@ func (t *vSphereCSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volum
 
 		Spec: v1.PersistentVolumeSpec{
 			PersistentVolumeSource: v1.PersistentVolumeSource{
-				CSI: &v1.CSIPersistentVolumeSource{
-					Driver:       VSphereDriverName,
-					VolumeHandle: volume.VsphereVolume.VolumePath,
-					FSType:       volume.VsphereVolume.FSType,
-					VolumeAttributes: map[string]string{
-						"storagepolicyname": volume.VsphereVolume.StoragePolicyName,
-					},
-				},
+				CSI: csiSource,
 			},
-			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			AccessModes: []v1.PersistentVolumeAccessMode{accessMode},
 		},
 	}
 	return pv, nil
@@ -94,22 +233,110 @@ func (t *vSphereCSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (
 		return nil, fmt.Errorf("pv is nil or VsphereVolume not defined on pv")
 	}
 	csiSource := &v1.CSIPersistentVolumeSource{
-		Driver:       VSphereDriverName,
-		VolumeHandle: pv.Spec.VsphereVolume.VolumePath,
-		FSType:       pv.Spec.VsphereVolume.FSType,
-		VolumeAttributes: map[string]string{
-			"storagepolicyname": pv.Spec.VsphereVolume.StoragePolicyName,
-		},
+		Driver:           VSphereDriverName,
+		VolumeHandle:     pv.Spec.VsphereVolume.VolumePath,
+		FSType:           pv.Spec.VsphereVolume.FSType,
+		VolumeAttributes: map[string]string{},
+	}
+	if pv.Spec.VsphereVolume.StoragePolicyName != "" {
+		// The CSI driver treats an empty storagepolicyname as an invalid
+		// policy, so omit the attribute entirely rather than pass through
+		// an empty string.
+		csiSource.VolumeAttributes[storagePolicyNameKey] = pv.Spec.VsphereVolume.StoragePolicyName
 	}
 	pv.Spec.VsphereVolume = nil
 	pv.Spec.CSI = csiSource
+	if nodeAffinity := translateTopologyLabelsToNodeAffinity(pv.Labels); nodeAffinity != nil {
+		pv.Spec.NodeAffinity = nodeAffinity
+	}
 	return pv, nil
 }
 
+// translateTopologyLabelsToNodeAffinity reads the in-tree zone/region
+// failure-domain labels (including the "__"-delimited multi-zone
+// convention) off a PV and synthesizes the equivalent vSphere CSI
+// NodeAffinity, so migrated PVs keep scheduling correctly on zoned
+// clusters. Returns nil if neither label is present.
+func translateTopologyLabelsToNodeAffinity(labels map[string]string) *v1.VolumeNodeAffinity {
+	var requirements []v1.NodeSelectorRequirement
+	if zone, ok := labels[zoneLabel]; ok && zone != "" {
+		requirements = append(requirements, v1.NodeSelectorRequirement{
+			Key:      topologyZoneKey,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   strings.Split(zone, zoneLabelDelimiter),
+		})
+	}
+	if region, ok := labels[regionLabel]; ok && region != "" {
+		requirements = append(requirements, v1.NodeSelectorRequirement{
+			Key:      topologyRegionKey,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   strings.Split(region, zoneLabelDelimiter),
+		})
+	}
+	if len(requirements) == 0 {
+		return nil
+	}
+	return &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: requirements},
+			},
+		},
+	}
+}
+
 // TranslateCSIPVToInTree takes a PV with CSIPersistentVolumeSource set and
 // translates the vSphere CSI source to a vSphereVolume source.
 func (t *vSphereCSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
-	return nil, fmt.Errorf("VsphereVolume does not support TranslateCSIPVToInTree")
+	if pv == nil || pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("pv is nil or CSI source not defined on pv")
+	}
+	csiSource := pv.Spec.CSI
+	if csiSource.Driver != VSphereDriverName {
+		return nil, fmt.Errorf("driver name %s is not the vSphere CSI driver name %s", csiSource.Driver, VSphereDriverName)
+	}
+	pv.Spec.VsphereVolume = &v1.VsphereVirtualDiskVolumeSource{
+		VolumePath:        csiSource.VolumeHandle,
+		FSType:            csiSource.FSType,
+		StoragePolicyName: csiSource.VolumeAttributes["storagepolicyname"],
+	}
+	pv.Spec.CSI = nil
+	translateNodeAffinityToTopologyLabels(pv)
+	return pv, nil
+}
+
+// translateNodeAffinityToTopologyLabels reverses
+// translateTopologyLabelsToNodeAffinity: it recovers the in-tree zone/region
+// failure-domain labels from the vSphere CSI NodeAffinity placed on the PV
+// and clears the NodeAffinity, since in-tree vSphere volumes express
+// placement through labels rather than node affinity.
+func translateNodeAffinityToTopologyLabels(pv *v1.PersistentVolume) {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, req := range term.MatchExpressions {
+			switch req.Key {
+			case topologyZoneKey:
+				setTopologyLabel(pv, zoneLabel, req.Values)
+			case topologyRegionKey:
+				setTopologyLabel(pv, regionLabel, req.Values)
+			}
+		}
+	}
+	pv.Spec.NodeAffinity = nil
+}
+
+// setTopologyLabel joins values with the multi-zone delimiter and sets them
+// on the PV under the given in-tree label key.
+func setTopologyLabel(pv *v1.PersistentVolume, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	if pv.Labels == nil {
+		pv.Labels = map[string]string{}
+	}
+	pv.Labels[key] = strings.Join(values, zoneLabelDelimiter)
 }
 
 // CanSupport tests whether the plugin supports a given persistent volume
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTranslateVSphereInTreePVToCSIAndBack(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+
+	cases := []struct {
+		name string
+		pv   *v1.PersistentVolume
+	}{
+		{
+			name: "no topology labels",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pv"},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+							VolumePath:        "[datastore1] volumes/myDisk",
+							FSType:            "ext4",
+							StoragePolicyName: "gold",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "single zone and region",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-pv",
+					Labels: map[string]string{
+						zoneLabel:   "zone-a",
+						regionLabel: "region-1",
+					},
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+							VolumePath: "[datastore1] volumes/myDisk",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "multi-zone delimiter",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-pv",
+					Labels: map[string]string{
+						zoneLabel: "zone-a__zone-b",
+					},
+				},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+							VolumePath: "[datastore1] volumes/myDisk",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			original := c.pv.DeepCopy()
+
+			csiPV, err := translator.TranslateInTreePVToCSI(c.pv.DeepCopy())
+			if err != nil {
+				t.Fatalf("failed to translate in-tree PV to CSI: %v", err)
+			}
+			if csiPV.Spec.CSI == nil {
+				t.Fatalf("expected CSI source to be set")
+			}
+
+			inTreePV, err := translator.TranslateCSIPVToInTree(csiPV)
+			if err != nil {
+				t.Fatalf("failed to translate CSI PV to in-tree: %v", err)
+			}
+
+			if !reflect.DeepEqual(original, inTreePV) {
+				t.Errorf("round trip mismatch\nwant: %+v\ngot: %+v", original, inTreePV)
+			}
+		})
+	}
+}
+
+func TestTranslateInTreePVToCSIOmitsEmptyStoragePolicyName(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+					VolumePath: "[datastore1] volumes/myDisk",
+				},
+			},
+		},
+	}
+	csiPV, err := translator.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := csiPV.Spec.CSI.VolumeAttributes["storagepolicyname"]; ok {
+		t.Error("expected storagepolicyname attribute to be omitted when empty")
+	}
+}
+
+func TestTranslateCSIPVToInTreeWrongDriver(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver: "some.other.driver",
+				},
+			},
+		},
+	}
+	if _, err := translator.TranslateCSIPVToInTree(pv); err == nil {
+		t.Error("expected error translating PV from an unrelated CSI driver, got none")
+	}
+}
+
+func TestTranslateInTreeStorageClassToCSIParameters(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+
+	t.Run("diskformat dropped and datastore renamed", func(t *testing.T) {
+		sc := &storage.StorageClass{
+			Parameters: map[string]string{
+				"diskformat": "zeroedthick",
+				"datastore":  "https://my.datastore.url",
+				"fstype":     "ext4",
+			},
+		}
+		got, err := translator.TranslateInTreeStorageClassToCSI(sc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := map[string]string{
+			"datastoreurl": "https://my.datastore.url",
+			"fstype":       "ext4",
+		}
+		if !reflect.DeepEqual(got.Parameters, want) {
+			t.Errorf("got %v, want %v", got.Parameters, want)
+		}
+	})
+
+	t.Run("spbm knobs without storagepolicyname is a migration blocker", func(t *testing.T) {
+		sc := &storage.StorageClass{
+			Parameters: map[string]string{
+				"hostfailurestotolerate": "1",
+			},
+		}
+		if _, err := translator.TranslateInTreeStorageClassToCSI(sc); err == nil {
+			t.Error("expected an UnsupportedParameterError, got none")
+		} else if _, ok := err.(*UnsupportedParameterError); !ok {
+			t.Errorf("expected an UnsupportedParameterError, got %T: %v", err, err)
+		}
+	})
+
+	t.Run("spbm knobs with storagepolicyname are preserved as annotations", func(t *testing.T) {
+		sc := &storage.StorageClass{
+			Parameters: map[string]string{
+				"storagepolicyname":      "gold",
+				"hostfailurestotolerate": "1",
+			},
+		}
+		got, err := translator.TranslateInTreeStorageClassToCSI(sc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := got.Parameters["hostfailurestotolerate"]; ok {
+			t.Error("expected hostfailurestotolerate to be removed from parameters")
+		}
+		if got.Annotations[VSphereDriverName+"/hostfailurestotolerate"] != "1" {
+			t.Errorf("expected legacy knob preserved as annotation, got %v", got.Annotations)
+		}
+	})
+
+	t.Run("storagepolicyname in other casing is still recognized as already set", func(t *testing.T) {
+		sc := &storage.StorageClass{
+			Parameters: map[string]string{
+				"StoragePolicyName":      "gold",
+				"hostfailurestotolerate": "1",
+			},
+		}
+		got, err := translator.TranslateInTreeStorageClassToCSI(sc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Annotations[VSphereDriverName+"/hostfailurestotolerate"] != "1" {
+			t.Errorf("expected legacy knob preserved as annotation, got %v", got.Annotations)
+		}
+	})
+}
+
+func TestTranslateInTreeStorageClassToCSIAllowedTopologies(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+	sc := &storage.StorageClass{
+		AllowedTopologies: []v1.TopologySelectorTerm{
+			{
+				MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: zoneLabel, Values: []string{"zone-a__zone-b"}},
+					{Key: regionLabel, Values: []string{"region-1"}},
+				},
+			},
+		},
+	}
+
+	got, err := translator.TranslateInTreeStorageClassToCSI(sc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []v1.TopologySelectorTerm{
+		{
+			MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+				{Key: topologyZoneKey, Values: []string{"zone-a", "zone-b"}},
+				{Key: topologyRegionKey, Values: []string{"region-1"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.AllowedTopologies, want) {
+		t.Errorf("got %+v, want %+v", got.AllowedTopologies, want)
+	}
+}
+
+func TestTranslateInTreeInlineVolumeToCSI(t *testing.T) {
+	translator := NewvSphereCSITranslator()
+
+	t.Run("read-only volume downgrades access mode", func(t *testing.T) {
+		volume := &v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+					VolumePath: "[datastore1] volumes/myDisk",
+				},
+			},
+		}
+		pv, err := translator.TranslateInTreeInlineVolumeToCSI(volume, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !pv.Spec.CSI.ReadOnly {
+			t.Error("expected CSI.ReadOnly to be true")
+		}
+		want := []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany}
+		if !reflect.DeepEqual(pv.Spec.AccessModes, want) {
+			t.Errorf("got access modes %v, want %v", pv.Spec.AccessModes, want)
+		}
+	})
+
+	t.Run("empty storage policy name is omitted", func(t *testing.T) {
+		volume := &v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{
+					VolumePath: "[datastore1] volumes/myDisk",
+				},
+			},
+		}
+		pv, err := translator.TranslateInTreeInlineVolumeToCSI(volume, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := pv.Spec.CSI.VolumeAttributes["storagepolicyname"]; ok {
+			t.Error("expected storagepolicyname attribute to be omitted when empty")
+		}
+		want := []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+		if !reflect.DeepEqual(pv.Spec.AccessModes, want) {
+			t.Errorf("got access modes %v, want %v", pv.Spec.AccessModes, want)
+		}
+	})
+}
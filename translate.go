@@ -0,0 +1,201 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package csitrans translates in-tree volume specifications (PVs, inline
+// volumes, StorageClasses) to and from their CSI equivalents, dispatching
+// to the InTreePlugin registered for the in-tree name, CSI name, or PV/
+// volume shape involved.
+package csitrans
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+
+	"github.com/divyenpatel/csi-translation-lib/plugins"
+)
+
+// CSITranslator translates in-tree storage source specifications to CSI
+// source specifications and vice-versa, by owning a registry of
+// InTreePlugins keyed by in-tree name and by CSI name.
+type CSITranslator struct {
+	inTreePlugins map[string]plugins.InTreePlugin
+	csiPlugins    map[string]plugins.InTreePlugin
+}
+
+// New returns a CSITranslator with the default set of InTreePlugins
+// registered.
+func New() *CSITranslator {
+	return NewWithPlugins(plugins.NewvSphereCSITranslator())
+}
+
+// NewWithPlugins returns a CSITranslator with only the given plugins
+// registered. Tests use this to register mock InTreePlugins instead of the
+// default registry.
+func NewWithPlugins(ps ...plugins.InTreePlugin) *CSITranslator {
+	t := &CSITranslator{
+		inTreePlugins: make(map[string]plugins.InTreePlugin),
+		csiPlugins:    make(map[string]plugins.InTreePlugin),
+	}
+	for _, p := range ps {
+		t.inTreePlugins[p.GetInTreePluginName()] = p
+		t.csiPlugins[p.GetCSIPluginName()] = p
+	}
+	return t
+}
+
+// getPluginForPV returns the plugin that can support the given PV.
+func (t *CSITranslator) getPluginForPV(pv *v1.PersistentVolume) (plugins.InTreePlugin, error) {
+	for _, p := range t.inTreePlugins {
+		if p.CanSupport(pv) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find in-tree plugin for pv %+v", pv)
+}
+
+// getPluginForInline returns the plugin that can support the given inline
+// volume.
+func (t *CSITranslator) getPluginForInline(volume *v1.Volume) (plugins.InTreePlugin, error) {
+	for _, p := range t.inTreePlugins {
+		if p.CanSupportInline(volume) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find in-tree plugin for volume %+v", volume)
+}
+
+// getPluginForCSIPV returns the plugin registered for the CSI driver named
+// on the given PV.
+func (t *CSITranslator) getPluginForCSIPV(pv *v1.PersistentVolume) (plugins.InTreePlugin, error) {
+	if pv == nil || pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("pv is nil or does not have a CSI source")
+	}
+	if p, ok := t.csiPlugins[pv.Spec.CSI.Driver]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("could not find plugin for CSI driver %s", pv.Spec.CSI.Driver)
+}
+
+// IsPVMigratable tests whether there is a migratable plugin registered for
+// the given PV.
+func (t *CSITranslator) IsPVMigratable(pv *v1.PersistentVolume) bool {
+	_, err := t.getPluginForPV(pv)
+	return err == nil
+}
+
+// IsInlineMigratable tests whether there is a migratable plugin registered
+// for the given inline volume.
+func (t *CSITranslator) IsInlineMigratable(volume *v1.Volume) bool {
+	_, err := t.getPluginForInline(volume)
+	return err == nil
+}
+
+// GetCSINameFromInTreeName returns the name of the CSI driver that
+// supersedes the given in-tree plugin name.
+func (t *CSITranslator) GetCSINameFromInTreeName(inTreePluginName string) (string, error) {
+	p, ok := t.inTreePlugins[inTreePluginName]
+	if !ok {
+		return "", fmt.Errorf("could not find CSI driver name for in-tree plugin %s", inTreePluginName)
+	}
+	return p.GetCSIPluginName(), nil
+}
+
+// TranslateInTreePVToCSI translates a PV with an in-tree volume source to
+// one with an equivalent CSI volume source, using the plugin registered for
+// that in-tree source.
+func (t *CSITranslator) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	p, err := t.getPluginForPV(pv)
+	if err != nil {
+		return nil, err
+	}
+	return p.TranslateInTreePVToCSI(pv)
+}
+
+// TranslateCSIPVToInTree translates a PV with a CSI volume source to one
+// with an equivalent in-tree volume source, using the plugin registered for
+// that CSI driver.
+func (t *CSITranslator) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	p, err := t.getPluginForCSIPV(pv)
+	if err != nil {
+		return nil, err
+	}
+	return p.TranslateCSIPVToInTree(pv)
+}
+
+// TranslateInTreeInlineVolumeToCSI translates an inline volume with an
+// in-tree volume source to a PV with an equivalent CSI volume source, using
+// the plugin registered for that in-tree source.
+func (t *CSITranslator) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, readOnly bool) (*v1.PersistentVolume, error) {
+	p, err := t.getPluginForInline(volume)
+	if err != nil {
+		return nil, err
+	}
+	return p.TranslateInTreeInlineVolumeToCSI(volume, readOnly)
+}
+
+// TranslateInTreeStorageClassToCSI translates a StorageClass's in-tree
+// parameters to their CSI equivalents, using the plugin registered under the
+// given in-tree plugin name. The StorageClass's own Provisioner field is not
+// consulted.
+func (t *CSITranslator) TranslateInTreeStorageClassToCSI(inTreePluginName string, sc *storage.StorageClass) (*storage.StorageClass, error) {
+	p, ok := t.inTreePlugins[inTreePluginName]
+	if !ok {
+		return nil, fmt.Errorf("could not find in-tree plugin for provisioner %s", inTreePluginName)
+	}
+	return p.TranslateInTreeStorageClassToCSI(sc)
+}
+
+var defaultTranslator = New()
+
+// TranslateInTreePVToCSI is a convenience wrapper around a package-default
+// CSITranslator, for callers that don't need their own registry.
+func TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	return defaultTranslator.TranslateInTreePVToCSI(pv)
+}
+
+// TranslateCSIPVToInTree is a convenience wrapper around a package-default
+// CSITranslator, for callers that don't need their own registry.
+func TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	return defaultTranslator.TranslateCSIPVToInTree(pv)
+}
+
+// IsPVMigratable is a convenience wrapper around a package-default
+// CSITranslator, for callers that don't need their own registry.
+func IsPVMigratable(pv *v1.PersistentVolume) bool {
+	return defaultTranslator.IsPVMigratable(pv)
+}
+
+// IsInlineMigratable is a convenience wrapper around a package-default
+// CSITranslator, for callers that don't need their own registry.
+func IsInlineMigratable(volume *v1.Volume) bool {
+	return defaultTranslator.IsInlineMigratable(volume)
+}
+
+// TranslateInTreeInlineVolumeToCSI is a convenience wrapper around a
+// package-default CSITranslator, for callers that don't need their own
+// registry.
+func TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, readOnly bool) (*v1.PersistentVolume, error) {
+	return defaultTranslator.TranslateInTreeInlineVolumeToCSI(volume, readOnly)
+}
+
+// TranslateInTreeStorageClassToCSI is a convenience wrapper around a
+// package-default CSITranslator, for callers that don't need their own
+// registry.
+func TranslateInTreeStorageClassToCSI(inTreePluginName string, sc *storage.StorageClass) (*storage.StorageClass, error) {
+	return defaultTranslator.TranslateInTreeStorageClassToCSI(inTreePluginName, sc)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csitrans
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+)
+
+// mockPlugin is a minimal InTreePlugin used to exercise CSITranslator
+// without depending on a real plugin's translation logic.
+type mockPlugin struct {
+	inTreePluginName string
+	csiPluginName    string
+}
+
+func (m *mockPlugin) TranslateInTreeStorageClassToCSI(sc *storage.StorageClass) (*storage.StorageClass, error) {
+	return sc, nil
+}
+
+func (m *mockPlugin) TranslateInTreeInlineVolumeToCSI(volume *v1.Volume, readOnly bool) (*v1.PersistentVolume, error) {
+	return &v1.PersistentVolume{}, nil
+}
+
+func (m *mockPlugin) TranslateInTreePVToCSI(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	pv.Spec.CSI = &v1.CSIPersistentVolumeSource{Driver: m.csiPluginName}
+	return pv, nil
+}
+
+func (m *mockPlugin) TranslateCSIPVToInTree(pv *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != m.csiPluginName {
+		return nil, fmt.Errorf("pv is not owned by %s", m.csiPluginName)
+	}
+	pv.Spec.CSI = nil
+	return pv, nil
+}
+
+func (m *mockPlugin) CanSupport(pv *v1.PersistentVolume) bool {
+	return pv != nil && pv.Labels["mock"] == m.inTreePluginName
+}
+
+func (m *mockPlugin) CanSupportInline(volume *v1.Volume) bool {
+	return true
+}
+
+func (m *mockPlugin) GetInTreePluginName() string {
+	return m.inTreePluginName
+}
+
+func (m *mockPlugin) GetCSIPluginName() string {
+	return m.csiPluginName
+}
+
+func (m *mockPlugin) RepairVolumeHandle(volumeHandle, nodeID string) (string, error) {
+	return volumeHandle, nil
+}
+
+func TestCSITranslatorDispatch(t *testing.T) {
+	mock := &mockPlugin{inTreePluginName: "mock.example.com/mock", csiPluginName: "mock.csi.example.com"}
+	translator := NewWithPlugins(mock)
+
+	pv := &v1.PersistentVolume{}
+	pv.Labels = map[string]string{"mock": mock.inTreePluginName}
+
+	if !translator.IsPVMigratable(pv) {
+		t.Fatal("expected pv to be migratable")
+	}
+
+	csiName, err := translator.GetCSINameFromInTreeName(mock.inTreePluginName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if csiName != mock.csiPluginName {
+		t.Errorf("got %s, want %s", csiName, mock.csiPluginName)
+	}
+
+	csiPV, err := translator.TranslateInTreePVToCSI(pv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if csiPV.Spec.CSI == nil || csiPV.Spec.CSI.Driver != mock.csiPluginName {
+		t.Fatalf("expected pv to have CSI source for %s", mock.csiPluginName)
+	}
+
+	inTreePV, err := translator.TranslateCSIPVToInTree(csiPV)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inTreePV.Spec.CSI != nil {
+		t.Error("expected CSI source to be cleared")
+	}
+
+	if _, err := translator.TranslateInTreeInlineVolumeToCSI(&v1.Volume{}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := translator.TranslateInTreeStorageClassToCSI(mock.inTreePluginName, &storage.StorageClass{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := translator.TranslateInTreeStorageClassToCSI("does-not-exist", &storage.StorageClass{}); err == nil {
+		t.Error("expected an error for an unregistered in-tree plugin name")
+	}
+}
+
+func TestCSITranslatorNoMatchingPlugin(t *testing.T) {
+	translator := NewWithPlugins()
+	if translator.IsPVMigratable(&v1.PersistentVolume{}) {
+		t.Error("expected no migratable plugin with an empty registry")
+	}
+	if _, err := translator.GetCSINameFromInTreeName("does-not-exist"); err == nil {
+		t.Error("expected an error for an unregistered in-tree plugin name")
+	}
+}
+
+func TestCSITranslatorTranslateCSIPVToInTreeNilPV(t *testing.T) {
+	translator := New()
+	if _, err := translator.TranslateCSIPVToInTree(nil); err == nil {
+		t.Error("expected an error translating a nil PV, got none")
+	}
+}